@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// embeddedSnippetLabelPair is the sidecar record persisted alongside a
+// deduplicated pair, so downstream consumers can build a vector index
+// without re-embedding.
+type embeddedSnippetLabelPair struct {
+	Label     string    `json:"label"`
+	Snippet   string    `json:"snippet"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// dedupeByEmbeddings embeds every snippet, clusters near-duplicates whose
+// cosine similarity is at or above threshold, and keeps one representative
+// pair per cluster with the cluster's distinct labels merged together.
+// Embedding requests go through limiter and maxRetries the same way chat
+// completions do, so a transient 429/5xx retries instead of silently
+// falling back to undeduplicated output, and the dedupe pass can't blow
+// through the configured --rpm/--tpm budget.
+func dedupeByEmbeddings(provider Provider, pairs []SnippetLabelPair, model string, threshold float64, limiter *RateLimiter, maxRetries int) ([]embeddedSnippetLabelPair, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	texts := make([]string, len(pairs))
+	for i, pair := range pairs {
+		texts[i] = pair.Snippet
+	}
+
+	embeddings, err := embedRateLimited(provider, texts, model, limiter, maxRetries)
+	if err != nil {
+		return nil, fmt.Errorf("error computing embeddings: %w", err)
+	}
+	if len(embeddings) != len(pairs) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(pairs), len(embeddings))
+	}
+
+	assigned := make([]bool, len(pairs))
+	var deduped []embeddedSnippetLabelPair
+
+	for i := range pairs {
+		if assigned[i] {
+			continue
+		}
+		assigned[i] = true
+		cluster := []int{i}
+
+		for j := i + 1; j < len(pairs); j++ {
+			if assigned[j] {
+				continue
+			}
+			if cosineSimilarity(embeddings[i], embeddings[j]) >= threshold {
+				assigned[j] = true
+				cluster = append(cluster, j)
+			}
+		}
+
+		deduped = append(deduped, embeddedSnippetLabelPair{
+			Label:     mergeLabels(pairs, cluster),
+			Snippet:   pairs[i].Snippet,
+			Embedding: embeddings[i],
+		})
+	}
+
+	return deduped, nil
+}
+
+// mergeLabels joins the distinct labels across a duplicate cluster so the
+// representative pair doesn't lose the other members' framing.
+func mergeLabels(pairs []SnippetLabelPair, cluster []int) string {
+	seen := make(map[string]bool, len(cluster))
+	var labels []string
+	for _, idx := range cluster {
+		label := pairs[idx].Label
+		if !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	return strings.Join(labels, "; ")
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// writeEmbeddingsSidecar persists deduplicated pairs and their embeddings as
+// a `.embeddings.jsonl` file, one record per line.
+func writeEmbeddingsSidecar(path string, pairs []embeddedSnippetLabelPair) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer out.Close()
+
+	for _, pair := range pairs {
+		line, err := json.Marshal(pair)
+		if err != nil {
+			return fmt.Errorf("failed to marshal embedding record: %w", err)
+		}
+		if _, err := out.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed writing to %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// embeddedPairsToSnippetLabelPairs strips the embeddings back off so the
+// deduplicated output can still be written as plain SnippetLabelPair JSON.
+func embeddedPairsToSnippetLabelPairs(pairs []embeddedSnippetLabelPair) []SnippetLabelPair {
+	out := make([]SnippetLabelPair, len(pairs))
+	for i, pair := range pairs {
+		out[i] = SnippetLabelPair{Label: pair.Label, Snippet: pair.Snippet}
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"identical", []float64{1, 0, 0}, []float64{1, 0, 0}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, 0}, []float64{-1, 0}, -1},
+		{"zero vector", []float64{0, 0}, []float64{1, 1}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := cosineSimilarity(c.a, c.b)
+			if math.Abs(got-c.want) > 1e-9 {
+				t.Errorf("cosineSimilarity(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+			}
+		})
+	}
+}
+
+// fakeEmbedProvider returns a fixed embedding per input text in order, with
+// no network calls, so dedupeByEmbeddings's clustering logic can be tested
+// in isolation.
+type fakeEmbedProvider struct {
+	embeddings [][]float64
+}
+
+func (p *fakeEmbedProvider) Complete(prompt string, opts CompletionOptions) (string, error) {
+	return "", nil
+}
+func (p *fakeEmbedProvider) CompleteChat(messages []ChatMessage, opts CompletionOptions) (string, error) {
+	return "", nil
+}
+func (p *fakeEmbedProvider) SupportsJSONMode(model string) bool { return false }
+func (p *fakeEmbedProvider) Embed(texts []string, model string) ([][]float64, error) {
+	return p.embeddings, nil
+}
+
+func TestDedupeByEmbeddingsMergesNearDuplicates(t *testing.T) {
+	provider := &fakeEmbedProvider{
+		embeddings: [][]float64{
+			{1, 0},
+			{1, 0}, // near-duplicate of pair 0
+			{0, 1},
+		},
+	}
+	pairs := []SnippetLabelPair{
+		{Label: "a", Snippet: "snippet a"},
+		{Label: "b", Snippet: "snippet b"},
+		{Label: "c", Snippet: "snippet c"},
+	}
+
+	deduped, err := dedupeByEmbeddings(provider, pairs, "text-embedding-3-small", 0.99, nil, 0)
+	if err != nil {
+		t.Fatalf("dedupeByEmbeddings: %s", err)
+	}
+	if len(deduped) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(deduped))
+	}
+	if deduped[0].Label != "a; b" {
+		t.Errorf("expected merged label %q, got %q", "a; b", deduped[0].Label)
+	}
+}
+
+func TestDedupeByEmbeddingsEmptyInput(t *testing.T) {
+	deduped, err := dedupeByEmbeddings(&fakeEmbedProvider{}, nil, "text-embedding-3-small", 0.9, nil, 0)
+	if err != nil {
+		t.Fatalf("dedupeByEmbeddings: %s", err)
+	}
+	if deduped != nil {
+		t.Errorf("expected nil for empty input, got %v", deduped)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/log"
+)
+
+// fineTuningExample is the JSONL record OpenAI's fine-tuning API expects:
+// one chat-style conversation per line.
+type fineTuningExample struct {
+	Messages []fineTuningMessage `json:"messages"`
+}
+
+type fineTuningMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// fineTuneClient wraps the handful of `/v1/files` and `/v1/fine_tuning/jobs`
+// calls the fine-tune subcommand needs.
+type fineTuneClient struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+}
+
+func newFineTuneClient(apiKey string) *fineTuneClient {
+	return &fineTuneClient{client: &http.Client{}, baseURL: "https://api.openai.com", apiKey: apiKey}
+}
+
+func (c *fineTuneClient) do(method, path string, body io.Reader, contentType string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, string(respBody))
+	}
+
+	return respBody, nil
+}
+
+// uploadFile uploads a JSONL training file with purpose=fine-tune and
+// returns the resulting file ID.
+func (c *fineTuneClient) uploadFile(jsonlPath string) (string, error) {
+	f, err := os.Open(jsonlPath)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", jsonlPath, err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	if err := writer.WriteField("purpose", "fine-tune"); err != nil {
+		return "", fmt.Errorf("error writing purpose field: %w", err)
+	}
+
+	part, err := writer.CreateFormFile("file", filepath.Base(jsonlPath))
+	if err != nil {
+		return "", fmt.Errorf("error creating form file: %w", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", fmt.Errorf("error copying file contents: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("error closing multipart writer: %w", err)
+	}
+
+	respBody, err := c.do("POST", "/v1/files", &buf, writer.FormDataContentType())
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return "", fmt.Errorf("error unmarshaling upload response: %w", err)
+	}
+
+	return response.ID, nil
+}
+
+// createJob kicks off a fine-tuning job against an uploaded training file.
+func (c *fineTuneClient) createJob(fileID, baseModel string, hyperparameters map[string]interface{}) ([]byte, error) {
+	payload := map[string]interface{}{
+		"training_file": fileID,
+		"model":         baseModel,
+	}
+	if len(hyperparameters) > 0 {
+		payload["hyperparameters"] = hyperparameters
+	}
+
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling job request: %w", err)
+	}
+
+	return c.do("POST", "/v1/fine_tuning/jobs", bytes.NewReader(requestBody), "application/json")
+}
+
+func (c *fineTuneClient) listJobs() ([]byte, error) {
+	return c.do("GET", "/v1/fine_tuning/jobs", nil, "")
+}
+
+func (c *fineTuneClient) retrieveJob(jobID string) ([]byte, error) {
+	return c.do("GET", "/v1/fine_tuning/jobs/"+jobID, nil, "")
+}
+
+func (c *fineTuneClient) cancelJob(jobID string) ([]byte, error) {
+	return c.do("POST", "/v1/fine_tuning/jobs/"+jobID+"/cancel", nil, "")
+}
+
+func (c *fineTuneClient) listEvents(jobID string) ([]byte, error) {
+	return c.do("GET", "/v1/fine_tuning/jobs/"+jobID+"/events", nil, "")
+}
+
+// buildTrainingJSONL reads every SnippetLabelPair JSON file in dir, converts
+// each pair into a fine-tuning chat example, and writes them out as one
+// JSONL file at outPath.
+func buildTrainingJSONL(dir, outPath string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read input directory: %w", err)
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", outPath, err)
+	}
+	defer out.Close()
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Errorf("Failed to read %s: %s", path, err)
+			continue
+		}
+
+		var pairs []SnippetLabelPair
+		if err := json.Unmarshal(content, &pairs); err != nil {
+			log.Errorf("Failed to parse %s: %s", path, err)
+			continue
+		}
+
+		for _, pair := range pairs {
+			example := fineTuningExample{
+				Messages: []fineTuningMessage{
+					{Role: "user", Content: pair.Snippet},
+					{Role: "assistant", Content: pair.Label},
+				},
+			}
+			line, err := json.Marshal(example)
+			if err != nil {
+				log.Errorf("Failed to marshal training example: %s", err)
+				continue
+			}
+			if _, err := out.Write(append(line, '\n')); err != nil {
+				return fmt.Errorf("failed writing to %s: %w", outPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runFineTune implements the `scander fine-tune` subcommand: `create` turns
+// an output directory of SnippetLabelPair files into a fine-tuning job, and
+// `list`/`retrieve`/`cancel`/`list-events` manage jobs already in flight.
+func runFineTune(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: scander fine-tune <create|list|retrieve|cancel|list-events> [flags]")
+	}
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		log.Fatal("OPENAI_API_KEY is not set in environment variables.")
+	}
+	client := newFineTuneClient(apiKey)
+
+	op := args[0]
+	rest := args[1:]
+
+	switch op {
+	case "create":
+		fs := flag.NewFlagSet("fine-tune create", flag.ExitOnError)
+		inputDir := fs.String("input", "", "Path to a directory of SnippetLabelPair JSON files")
+		baseModel := fs.String("model", "gpt-3.5-turbo", "Base model to fine-tune")
+		epochs := fs.Int("epochs", 0, "Number of training epochs (0 lets the API choose automatically)")
+		fs.Parse(rest)
+
+		if *inputDir == "" {
+			log.Fatal("Please specify an input directory using the --input flag.")
+		}
+
+		jsonlPath := filepath.Join(os.TempDir(), "scander-fine-tune.jsonl")
+		if err := buildTrainingJSONL(*inputDir, jsonlPath); err != nil {
+			log.Fatalf("Failed to build training file: %s", err)
+		}
+		defer os.Remove(jsonlPath)
+
+		fileID, err := client.uploadFile(jsonlPath)
+		if err != nil {
+			log.Fatalf("Failed to upload training file: %s", err)
+		}
+		log.Infof("Uploaded training file: %s", fileID)
+
+		hyperparameters := map[string]interface{}{}
+		if *epochs > 0 {
+			hyperparameters["n_epochs"] = *epochs
+		}
+
+		respBody, err := client.createJob(fileID, *baseModel, hyperparameters)
+		if err != nil {
+			log.Fatalf("Failed to create fine-tuning job: %s", err)
+		}
+		fmt.Println(string(respBody))
+
+	case "list":
+		respBody, err := client.listJobs()
+		if err != nil {
+			log.Fatalf("Failed to list fine-tuning jobs: %s", err)
+		}
+		fmt.Println(string(respBody))
+
+	case "retrieve":
+		if len(rest) == 0 {
+			log.Fatal("Usage: scander fine-tune retrieve <job_id>")
+		}
+		respBody, err := client.retrieveJob(rest[0])
+		if err != nil {
+			log.Fatalf("Failed to retrieve fine-tuning job: %s", err)
+		}
+		fmt.Println(string(respBody))
+
+	case "cancel":
+		if len(rest) == 0 {
+			log.Fatal("Usage: scander fine-tune cancel <job_id>")
+		}
+		respBody, err := client.cancelJob(rest[0])
+		if err != nil {
+			log.Fatalf("Failed to cancel fine-tuning job: %s", err)
+		}
+		fmt.Println(string(respBody))
+
+	case "list-events":
+		if len(rest) == 0 {
+			log.Fatal("Usage: scander fine-tune list-events <job_id>")
+		}
+		respBody, err := client.listEvents(rest[0])
+		if err != nil {
+			log.Fatalf("Failed to list fine-tuning job events: %s", err)
+		}
+		fmt.Println(string(respBody))
+
+	default:
+		log.Fatalf("Unknown fine-tune operation %q (expected one of: create, list, retrieve, cancel, list-events)", op)
+	}
+}
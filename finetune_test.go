@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildTrainingJSONL(t *testing.T) {
+	dir := t.TempDir()
+
+	pairs := []SnippetLabelPair{
+		{Label: "topic a", Snippet: "snippet a"},
+		{Label: "topic b", Snippet: "snippet b"},
+	}
+	data, err := json.Marshal(pairs)
+	if err != nil {
+		t.Fatalf("json.Marshal: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "doc.json"), data, 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	// Non-.json files should be ignored.
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignore me"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	outPath := filepath.Join(dir, "out.jsonl")
+	if err := buildTrainingJSONL(dir, outPath); err != nil {
+		t.Fatalf("buildTrainingJSONL: %s", err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(lines) != len(pairs) {
+		t.Fatalf("expected %d training examples, got %d: %q", len(pairs), len(lines), lines)
+	}
+
+	var example fineTuningExample
+	if err := json.Unmarshal([]byte(lines[0]), &example); err != nil {
+		t.Fatalf("unmarshal training example: %s", err)
+	}
+	if len(example.Messages) != 2 {
+		t.Fatalf("expected 2 messages per example, got %d", len(example.Messages))
+	}
+	if example.Messages[0].Role != "user" || example.Messages[0].Content != "snippet a" {
+		t.Errorf("unexpected user message: %+v", example.Messages[0])
+	}
+	if example.Messages[1].Role != "assistant" || example.Messages[1].Content != "topic a" {
+		t.Errorf("unexpected assistant message: %+v", example.Messages[1])
+	}
+}
+
+func TestBuildTrainingJSONLEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "out.jsonl")
+
+	if err := buildTrainingJSONL(dir, outPath); err != nil {
+		t.Fatalf("buildTrainingJSONL: %s", err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("expected an empty output file, got %q", out)
+	}
+}
+
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -21,29 +19,53 @@ type SnippetLabelPair struct {
 	Snippet string `json:"snippet"`
 }
 
-const (
-	maxTokens = 2000
-)
-
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fine-tune" {
+		runFineTune(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Warn("Warning: .env file not found.")
 	}
 
 	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY is not set in environment variables.")
-	}
 
 	inputDirPath := flag.String("input", "", "Path to the input directory")
 	outputDirPath := flag.String("output", "output", "Path to the output directory")
+	providerName := flag.String("provider", envOrDefault("SCANDER_PROVIDER", "openai"), "LLM backend to use: openai, localai, ollama, azure")
+	baseURL := flag.String("base-url", os.Getenv("SCANDER_BASE_URL"), "Base URL for self-hosted OpenAI-compatible backends (LocalAI, Ollama, Azure)")
+	model := flag.String("model", envOrDefault("SCANDER_MODEL", defaultCompletionOptions().Model), "Model (or Azure deployment name) to request completions from")
+	concurrency := flag.Int("concurrency", 4, "Number of files to process concurrently")
+	requestsPerMinute := flag.Int("rpm", 60, "Max requests per minute across all workers (0 disables the limit)")
+	tokensPerMinute := flag.Int("tpm", 90000, "Max tokens per minute across all workers (0 disables the limit)")
+	maxRetries := flag.Int("max-retries", 5, "Max retries per request on 429/5xx responses")
+	overlapTokens := flag.Int("overlap", 200, "Token overlap carried between adjacent chunks")
+	completionBudget := flag.Int("completion-budget", 2000, "Tokens reserved for the model's completion when sizing chunks")
+	dedupe := flag.Bool("dedupe", false, "Embed snippets and collapse near-duplicates after extraction")
+	dedupeThreshold := flag.Float64("dedupe-threshold", 0.92, "Cosine similarity at or above which two snippets are considered duplicates")
+	embeddingModel := flag.String("embedding-model", "text-embedding-3-small", "Embedding model used for --dedupe")
 	flag.Parse()
 
 	if *inputDirPath == "" {
 		log.Fatal("Please specify an input directory path using the --input flag.")
 	}
 
+	provider, err := NewProvider(*providerName, *baseURL, apiKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize provider: %s", err)
+	}
+
+	splitter, err := newTokenSplitter(*model)
+	if err != nil {
+		log.Fatalf("Failed to initialize tokenizer: %s", err)
+	}
+
 	if err := os.MkdirAll(*outputDirPath, os.ModePerm); err != nil {
 		log.Fatalf("Failed to create output directory: %s", err)
 	}
@@ -55,107 +77,76 @@ func main() {
 		log.Fatalf("Failed to read input directory: %s", err)
 	}
 
+	var jobs []fileJob
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
 
-		inputFilePath := filepath.Join(*inputDirPath, file.Name())
-		log.Infof("Processing file: %s", inputFilePath)
-
-		content, err := ioutil.ReadFile(inputFilePath)
-		if err != nil {
-			log.Errorf("Failed to read input file: %s", err)
-			continue
-		}
-
-		var snippetLabelPairs []SnippetLabelPair
-		chunks := splitText(string(content), maxTokens)
-		for _, chunk := range chunks {
-			log.Info("Getting snippet label pairs...")
-			pairs := processText(chunk, apiKey)
-			snippetLabelPairs = append(snippetLabelPairs, pairs...)
-		}
-
-		outputData, err := json.MarshalIndent(snippetLabelPairs, "", "  ")
-		if err != nil {
-			log.Errorf("Failed to marshal data into JSON: %s", err)
-			continue
-		}
-
 		outputFileName := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())) + ".json"
-		outputFilePath := filepath.Join(*outputDirPath, outputFileName)
-
-		if err := ioutil.WriteFile(outputFilePath, outputData, 0644); err != nil {
-			log.Errorf("Failed to write output to file: %s", err)
-			continue
-		}
-
-		log.Infof("Output successfully written to %s", outputFilePath)
+		jobs = append(jobs, fileJob{
+			inputPath:  filepath.Join(*inputDirPath, file.Name()),
+			outputPath: filepath.Join(*outputDirPath, outputFileName),
+		})
 	}
 
-	log.Info("Processing completed.")
-}
+	limiter := NewRateLimiter(*requestsPerMinute, *tokensPerMinute)
+	dedupeOpts := dedupeOptions{enabled: *dedupe, threshold: *dedupeThreshold, embeddingModel: *embeddingModel}
+	runWorkerPool(jobs, *concurrency, provider, limiter, *maxRetries, splitter, *model, contextWindowForModel(*model), *completionBudget, *overlapTokens, dedupeOpts)
 
-func processText(text, apiKey string) []SnippetLabelPair {
-	return generateSnippetLabelPairs(text, apiKey)
+	log.Info("Processing completed.")
 }
 
-func generateSnippetLabelPairs(text, apiKey string) []SnippetLabelPair {
-	client := &http.Client{}
-	prompt := fmt.Sprintf("Please read the following text and generate an array of label/snippet objects. Each object should contain a concise label for the main theme or idea discussed in the snippet, along with the corresponding snippet of text:\n\n\"%s\"", text)
-
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"model":       "gpt-3.5-turbo",
-		"messages":    []map[string]string{{"role": "user", "content": prompt}},
-		"temperature": 0.7,
-		"max_tokens":  2000,
-		"top_p":       1.0,
-		"n":           1,
-	})
+func readFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Error marshaling request body: %s", err)
+		return "", err
 	}
+	return string(content), nil
+}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewReader(requestBody))
+func writeSnippetLabelPairs(path string, pairs []SnippetLabelPair) error {
+	outputData, err := json.MarshalIndent(pairs, "", "  ")
 	if err != nil {
-		log.Fatalf("Error creating request: %s", err)
+		return fmt.Errorf("failed to marshal data into JSON: %w", err)
 	}
+	return ioutil.WriteFile(path, outputData, 0644)
+}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-	req.Header.Set("Content-Type", "application/json")
+// structuredOutputAttempts bounds how many structured-output requests
+// generateSnippetLabelPairsWithOptions makes in total (the first try plus
+// retries after malformed JSON, empty content or a request error) before
+// falling back to the regex path. The fallback costs a second full
+// completion request, so it's worth a retry on the cheaper,
+// already-supported structured path first.
+const structuredOutputAttempts = 2
+
+// generateSnippetLabelPairsWithOptions extracts label/snippet pairs from
+// text using the given CompletionOptions, so callers like the worker pool
+// and the HTTP server can honor a caller-supplied model/max_tokens instead
+// of always using the defaults.
+func generateSnippetLabelPairsWithOptions(text string, provider Provider, opts CompletionOptions, limiter *RateLimiter, maxRetries int) ([]SnippetLabelPair, error) {
+	prompt := fmt.Sprintf("Please read the following text and generate an array of label/snippet objects. Each object should contain a concise label for the main theme or idea discussed in the snippet, along with the corresponding snippet of text:\n\n\"%s\"", text)
 
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalf("Error making request to OpenAI: %s", err)
+	if provider.SupportsJSONMode(opts.Model) {
+		for attempt := 1; attempt <= structuredOutputAttempts; attempt++ {
+			if pairs, ok := generateSnippetLabelPairsStructured(prompt, provider, opts, limiter, maxRetries); ok {
+				return pairs, nil
+			}
+			log.Warnf("Structured output attempt %d/%d failed to produce usable output", attempt, structuredOutputAttempts)
+		}
+		log.Warn("Structured output exhausted its retries; falling back to the regex path, which costs a second full completion request.")
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	responseContent, err := completeRateLimited(provider, prompt, opts, limiter, maxRetries)
 	if err != nil {
-		log.Fatalf("Error reading response body: %s", err)
+		return nil, fmt.Errorf("error completing prompt: %w", err)
 	}
 
-	log.Debugf("OpenAI API Response: %s", string(body))
-
-	var response struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-
-	if err := json.Unmarshal(body, &response); err != nil {
-		log.Fatalf("Error unmarshaling response: %s", err)
+	if responseContent == "" {
+		return []SnippetLabelPair{}, nil
 	}
 
-	if len(response.Choices) == 0 {
-		log.Warn("No choices were returned by OpenAI.")
-		return []SnippetLabelPair{}
-	}
-
-	responseContent := response.Choices[0].Message.Content
 	responseContent = strings.ReplaceAll(responseContent, "\\n", "")
 	responseContent = strings.ReplaceAll(responseContent, "\\\"", "\"")
 	responseContent = strings.TrimSpace(responseContent)
@@ -175,25 +166,13 @@ func generateSnippetLabelPairs(text, apiKey string) []SnippetLabelPair {
 		}
 	}
 
-	return snippetLabelPairs
+	return snippetLabelPairs, nil
 }
 
-func splitText(text string, maxTokens int) []string {
-	var chunks []string
-	words := strings.Fields(text)
-	currentChunk := ""
-
-	for _, word := range words {
-		if len(currentChunk)+len(word)+1 > maxTokens {
-			chunks = append(chunks, currentChunk)
-			currentChunk = ""
-		}
-		currentChunk += " " + word
-	}
-
-	if len(currentChunk) > 0 {
-		chunks = append(chunks, currentChunk)
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
-
-	return chunks
+	return fallback
 }
+
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// RetryableError marks a Provider error as safe to retry (a 429 or 5xx
+// response), optionally carrying the server's requested Retry-After delay.
+type RetryableError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return fmt.Sprintf("retryable provider error: status %d", e.StatusCode)
+}
+
+// parseRetryAfter reads a Retry-After header, which the spec allows to be
+// either a number of seconds or an HTTP date; we only bother with seconds
+// since that's what OpenAI-compatible backends send.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// RateLimiter is a two-bucket token-bucket limiter covering both
+// requests-per-minute and tokens-per-minute, since providers cap on both.
+type RateLimiter struct {
+	mu sync.Mutex
+
+	requestTokens   float64
+	requestCapacity float64
+	requestRate     float64 // tokens refilled per second
+
+	budgetTokens   float64
+	budgetCapacity float64
+	budgetRate     float64 // tokens refilled per second
+
+	lastRefill time.Time
+}
+
+// NewRateLimiter builds a limiter for the given requests-per-minute and
+// tokens-per-minute budgets. A zero value disables that bucket's limit.
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	r := &RateLimiter{lastRefill: time.Now()}
+
+	if requestsPerMinute > 0 {
+		r.requestCapacity = float64(requestsPerMinute)
+		r.requestRate = float64(requestsPerMinute) / 60.0
+		r.requestTokens = r.requestCapacity
+	}
+	if tokensPerMinute > 0 {
+		r.budgetCapacity = float64(tokensPerMinute)
+		r.budgetRate = float64(tokensPerMinute) / 60.0
+		r.budgetTokens = r.budgetCapacity
+	}
+
+	return r
+}
+
+func (r *RateLimiter) refillLocked() {
+	now := time.Now()
+	elapsed := now.Sub(r.lastRefill).Seconds()
+	r.lastRefill = now
+
+	if r.requestCapacity > 0 {
+		r.requestTokens = min(r.requestCapacity, r.requestTokens+elapsed*r.requestRate)
+	}
+	if r.budgetCapacity > 0 {
+		r.budgetTokens = min(r.budgetCapacity, r.budgetTokens+elapsed*r.budgetRate)
+	}
+}
+
+// Wait blocks until both a request slot and estimatedTokens worth of token
+// budget are available, then reserves them. If estimatedTokens alone
+// exceeds the configured tokens-per-minute budget, haveBudget could never
+// become true and this would spin forever, so the request is clamped down
+// to the full budget capacity instead: it still waits for a full refill,
+// but it no longer wedges the calling goroutine permanently.
+func (r *RateLimiter) Wait(estimatedTokens int) {
+	if r.budgetCapacity > 0 && float64(estimatedTokens) > r.budgetCapacity {
+		log.Warnf("Request estimated at %d tokens exceeds the %.0f token/min budget; clamping so it proceeds once the budget fully refills instead of blocking forever", estimatedTokens, r.budgetCapacity)
+		estimatedTokens = int(r.budgetCapacity)
+	}
+
+	for {
+		r.mu.Lock()
+		r.refillLocked()
+
+		haveRequest := r.requestCapacity == 0 || r.requestTokens >= 1
+		haveBudget := r.budgetCapacity == 0 || r.budgetTokens >= float64(estimatedTokens)
+
+		if haveRequest && haveBudget {
+			if r.requestCapacity > 0 {
+				r.requestTokens--
+			}
+			if r.budgetCapacity > 0 {
+				r.budgetTokens -= float64(estimatedTokens)
+			}
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// estimateTokens is a rough chars/4 heuristic used for rate-limit
+// reservations; it does not run the tokenizer splitText uses.
+func estimateTokens(s string) int {
+	return len(s)/4 + 1
+}
+
+// backoffDuration is capped exponential backoff: 1s, 2s, 4s, 8s, ... up to 30s.
+func backoffDuration(attempt int) time.Duration {
+	d := time.Second * time.Duration(1<<uint(attempt))
+	if d > 30*time.Second {
+		d = 30 * time.Second
+	}
+	return d
+}
+
+// withRetry retries fn on RetryableError with exponential backoff (honoring
+// the server's Retry-After when it sends one), and returns any other error
+// immediately.
+func withRetry[T any](fn func() (T, error), maxRetries int) (T, error) {
+	var zero T
+	var lastErr error
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		result, err := fn()
+		if err == nil {
+			return result, nil
+		}
+
+		var retryable *RetryableError
+		if !errors.As(err, &retryable) {
+			return zero, err
+		}
+
+		lastErr = err
+		wait := retryable.RetryAfter
+		if wait <= 0 {
+			wait = backoffDuration(attempt)
+		}
+		log.Warnf("Retryable error (attempt %d/%d): %s; waiting %s", attempt+1, maxRetries+1, err, wait)
+		time.Sleep(wait)
+	}
+
+	return zero, fmt.Errorf("exceeded %d retries: %w", maxRetries, lastErr)
+}
+
+// completeRateLimited reserves rate-limit budget for the request, then
+// completes it with withRetry.
+func completeRateLimited(provider Provider, prompt string, opts CompletionOptions, limiter *RateLimiter, maxRetries int) (string, error) {
+	if limiter != nil {
+		limiter.Wait(estimateTokens(prompt) + opts.MaxTokens)
+	}
+	return withRetry(func() (string, error) {
+		return provider.Complete(prompt, opts)
+	}, maxRetries)
+}
+
+// embedRateLimited reserves rate-limit budget across all input texts, then
+// embeds them with withRetry, the same way completeRateLimited does for
+// chat completions.
+func embedRateLimited(provider Provider, texts []string, model string, limiter *RateLimiter, maxRetries int) ([][]float64, error) {
+	if limiter != nil {
+		estimated := 0
+		for _, t := range texts {
+			estimated += estimateTokens(t)
+		}
+		limiter.Wait(estimated)
+	}
+	return withRetry(func() ([][]float64, error) {
+		return provider.Embed(texts, model)
+	}, maxRetries)
+}
+
+// fileJob is one unit of work for the worker pool: a single input file to
+// chunk, extract, and write out.
+type fileJob struct {
+	inputPath  string
+	outputPath string
+}
+
+// dedupeOptions configures the optional post-extraction embeddings +
+// near-duplicate collapsing pass.
+type dedupeOptions struct {
+	enabled        bool
+	threshold      float64
+	embeddingModel string
+}
+
+// runWorkerPool fans fileJobs out across concurrency workers, each handling
+// its file's chunks sequentially so output order within a file is preserved.
+// A failure on one file/chunk is logged and skipped rather than aborting
+// the rest of the batch.
+func runWorkerPool(jobs []fileJob, concurrency int, provider Provider, limiter *RateLimiter, maxRetries int, splitter *tokenSplitter, model string, contextWindow, completionBudget, overlapTokens int, dedupe dedupeOptions) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobCh := make(chan fileJob)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				processFile(job, provider, limiter, maxRetries, splitter, model, contextWindow, completionBudget, overlapTokens, dedupe)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		jobCh <- job
+	}
+	close(jobCh)
+
+	wg.Wait()
+}
+
+func processFile(job fileJob, provider Provider, limiter *RateLimiter, maxRetries int, splitter *tokenSplitter, model string, contextWindow, completionBudget, overlapTokens int, dedupe dedupeOptions) {
+	log.Infof("Processing file: %s", job.inputPath)
+
+	content, err := readFile(job.inputPath)
+	if err != nil {
+		log.Errorf("Failed to read input file: %s", err)
+		return
+	}
+
+	opts := defaultCompletionOptions()
+	opts.Model = model
+
+	var snippetLabelPairs []SnippetLabelPair
+	chunks := splitter.splitText(content, contextWindow, completionBudget, overlapTokens)
+	for i, chunk := range chunks {
+		log.Infof("Getting snippet label pairs for %s (chunk %d/%d)...", job.inputPath, i+1, len(chunks))
+		pairs, err := generateSnippetLabelPairsWithOptions(chunk, provider, opts, limiter, maxRetries)
+		if err != nil {
+			log.Errorf("Failed to process chunk %d/%d of %s: %s", i+1, len(chunks), job.inputPath, err)
+			continue
+		}
+		snippetLabelPairs = append(snippetLabelPairs, pairs...)
+	}
+
+	if dedupe.enabled {
+		deduped, err := dedupeByEmbeddings(provider, snippetLabelPairs, dedupe.embeddingModel, dedupe.threshold, limiter, maxRetries)
+		if err != nil {
+			log.Errorf("Failed to deduplicate %s, keeping raw output: %s", job.inputPath, err)
+		} else {
+			embeddingsPath := strings.TrimSuffix(job.outputPath, filepath.Ext(job.outputPath)) + ".embeddings.jsonl"
+			if err := writeEmbeddingsSidecar(embeddingsPath, deduped); err != nil {
+				log.Errorf("Failed to write embeddings sidecar for %s: %s", job.inputPath, err)
+			}
+			snippetLabelPairs = embeddedPairsToSnippetLabelPairs(deduped)
+		}
+	}
+
+	if err := writeSnippetLabelPairs(job.outputPath, snippetLabelPairs); err != nil {
+		log.Errorf("Failed to write output for %s: %s", job.inputPath, err)
+		return
+	}
+
+	log.Infof("Output successfully written to %s", job.outputPath)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitClampsOversizedRequest(t *testing.T) {
+	limiter := NewRateLimiter(0, 60) // 60 tokens/min budget
+
+	done := make(chan struct{})
+	go func() {
+		limiter.Wait(10000) // far exceeds the budget capacity
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Wait did not return for a request exceeding budget capacity; it's spinning forever")
+	}
+}
+
+func TestRateLimiterWaitReservesBudget(t *testing.T) {
+	limiter := NewRateLimiter(0, 600000) // 10000 tokens/sec refill
+
+	limiter.Wait(600000) // drains the budget entirely
+
+	start := time.Now()
+	limiter.Wait(1000) // needs ~100ms to refill
+	elapsed := time.Since(start)
+
+	if elapsed < 10*time.Millisecond {
+		t.Errorf("expected the second Wait to block for a refill, returned almost immediately (%s)", elapsed)
+	}
+}
+
+func TestRateLimiterWaitNoLimitDoesNotBlock(t *testing.T) {
+	limiter := NewRateLimiter(0, 0)
+
+	done := make(chan struct{})
+	go func() {
+		limiter.Wait(1_000_000)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Wait blocked despite both buckets being disabled")
+	}
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// CompletionOptions carries the knobs that used to be hardcoded inline in
+// generateSnippetLabelPairs, so every Provider implementation can honor them
+// the same way.
+type CompletionOptions struct {
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	TopP        float64
+
+	// ResponseSchema, when set, requests structured JSON-mode output
+	// constrained to this JSON schema instead of free-form text.
+	// SchemaName is the name OpenAI's response_format expects for it.
+	ResponseSchema map[string]interface{}
+	SchemaName     string
+}
+
+// ChatMessage is one message in a chat-style conversation, kept structured
+// all the way down to the wire request so a message's Content can never be
+// mistaken for a role boundary.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Provider is anything that can turn a prompt into a completion string.
+// Splitting transport (HTTP request/response handling) from the extraction
+// logic in generateSnippetLabelPairsWithOptions lets us add new backends by implementing
+// this single interface.
+type Provider interface {
+	Complete(prompt string, opts CompletionOptions) (string, error)
+
+	// CompleteChat is Complete for a full, structured conversation rather
+	// than a single user prompt. Callers that need to inject a system
+	// message ahead of caller-supplied messages (e.g. the HTTP server's
+	// /v1/chat/completions passthrough) must use this instead of flattening
+	// messages into one string, since flattening lets message content forge
+	// a role boundary.
+	CompleteChat(messages []ChatMessage, opts CompletionOptions) (string, error)
+
+	// SupportsJSONMode reports whether the given model on this backend
+	// advertises structured JSON-schema output, so callers know whether to
+	// request it or fall back to regex-scraping free-form text.
+	SupportsJSONMode(model string) bool
+
+	// Embed returns one embedding vector per input text, in order.
+	Embed(texts []string, model string) ([][]float64, error)
+}
+
+// embeddingsResponse is the subset of the OpenAI-compatible embeddings
+// response shared across providers.
+type embeddingsResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// openAICompatibleEmbed issues an embeddings request against any server
+// that speaks the OpenAI wire format and returns one vector per input text.
+func openAICompatibleEmbed(client *http.Client, url, apiKey string, headers map[string]string, model string, texts []string) ([][]float64, error) {
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"model": model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	if apiKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, &RetryableError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var response embeddingsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error unmarshaling embeddings response: %w", err)
+	}
+
+	vectors := make([][]float64, len(response.Data))
+	for i, d := range response.Data {
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// jsonModeModelPrefixes lists the known OpenAI/Azure model families that
+// support response_format: {"type": "json_schema"}.
+var jsonModeModelPrefixes = []string{
+	"gpt-4o",
+	"gpt-4-turbo",
+	"gpt-4-1106",
+	"gpt-4-0125",
+	"gpt-3.5-turbo-1106",
+	"gpt-3.5-turbo-0125",
+	"o1",
+	"o3",
+}
+
+func modelSupportsJSONMode(model string) bool {
+	for _, prefix := range jsonModeModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultCompletionOptions mirrors the values generateSnippetLabelPairs used
+// to send before providers existed.
+func defaultCompletionOptions() CompletionOptions {
+	return CompletionOptions{
+		Model:       "gpt-3.5-turbo",
+		Temperature: 0.7,
+		MaxTokens:   2000,
+		TopP:        1.0,
+	}
+}
+
+// chatCompletionResponse is the subset of the OpenAI-compatible chat
+// completion response shared by OpenAI, LocalAI, Ollama, and Azure OpenAI.
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// openAICompatibleComplete issues a chat-completions request for a single
+// user prompt. It's a thin wrapper over openAICompatibleCompleteChat.
+func openAICompatibleComplete(client *http.Client, url, apiKey string, headers map[string]string, prompt string, opts CompletionOptions) (string, error) {
+	return openAICompatibleCompleteChat(client, url, apiKey, headers, []ChatMessage{{Role: "user", Content: prompt}}, opts)
+}
+
+// openAICompatibleCompleteChat issues a chat-completions request against any
+// server that speaks the OpenAI wire format and returns the first choice's
+// message content. Messages are passed through as structured role/content
+// pairs, never concatenated into one string, so message content can't be
+// crafted to forge a role boundary.
+func openAICompatibleCompleteChat(client *http.Client, url, apiKey string, headers map[string]string, messages []ChatMessage, opts CompletionOptions) (string, error) {
+	payload := map[string]interface{}{
+		"model":       opts.Model,
+		"messages":    messages,
+		"temperature": opts.Temperature,
+		"max_tokens":  opts.MaxTokens,
+		"top_p":       opts.TopP,
+		"n":           1,
+	}
+
+	if opts.ResponseSchema != nil {
+		payload["response_format"] = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   opts.SchemaName,
+				"schema": opts.ResponseSchema,
+				"strict": true,
+			},
+		}
+	}
+
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	if apiKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return "", &RetryableError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+
+	log.Debugf("Provider response: %s", string(body))
+
+	var response chatCompletionResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %w", err)
+	}
+
+	if len(response.Choices) == 0 {
+		log.Warn("No choices were returned by the provider.")
+		return "", nil
+	}
+
+	return response.Choices[0].Message.Content, nil
+}
+
+// OpenAIProvider talks to the hosted OpenAI API.
+type OpenAIProvider struct {
+	client *http.Client
+	apiKey string
+}
+
+func NewOpenAIProvider(apiKey string) *OpenAIProvider {
+	return &OpenAIProvider{client: &http.Client{}, apiKey: apiKey}
+}
+
+func (p *OpenAIProvider) Complete(prompt string, opts CompletionOptions) (string, error) {
+	return openAICompatibleComplete(p.client, "https://api.openai.com/v1/chat/completions", p.apiKey, nil, prompt, opts)
+}
+
+func (p *OpenAIProvider) CompleteChat(messages []ChatMessage, opts CompletionOptions) (string, error) {
+	return openAICompatibleCompleteChat(p.client, "https://api.openai.com/v1/chat/completions", p.apiKey, nil, messages, opts)
+}
+
+func (p *OpenAIProvider) SupportsJSONMode(model string) bool {
+	return modelSupportsJSONMode(model)
+}
+
+func (p *OpenAIProvider) Embed(texts []string, model string) ([][]float64, error) {
+	return openAICompatibleEmbed(p.client, "https://api.openai.com/v1/embeddings", p.apiKey, nil, model, texts)
+}
+
+// LocalAIProvider talks to a self-hosted OpenAI-compatible server, such as
+// LocalAI, at a user-supplied base URL.
+type LocalAIProvider struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+}
+
+func NewLocalAIProvider(baseURL, apiKey string) *LocalAIProvider {
+	return &LocalAIProvider{client: &http.Client{}, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey}
+}
+
+func (p *LocalAIProvider) Complete(prompt string, opts CompletionOptions) (string, error) {
+	url := fmt.Sprintf("%s/v1/chat/completions", p.baseURL)
+	return openAICompatibleComplete(p.client, url, p.apiKey, nil, prompt, opts)
+}
+
+func (p *LocalAIProvider) CompleteChat(messages []ChatMessage, opts CompletionOptions) (string, error) {
+	url := fmt.Sprintf("%s/v1/chat/completions", p.baseURL)
+	return openAICompatibleCompleteChat(p.client, url, p.apiKey, nil, messages, opts)
+}
+
+// SupportsJSONMode is conservatively false: self-hosted LocalAI backends
+// vary in which loaded model (if any) actually honors response_format, so
+// this backend always uses the regex path; there is no setting to enable
+// structured output for it.
+func (p *LocalAIProvider) SupportsJSONMode(model string) bool {
+	return false
+}
+
+func (p *LocalAIProvider) Embed(texts []string, model string) ([][]float64, error) {
+	url := fmt.Sprintf("%s/v1/embeddings", p.baseURL)
+	return openAICompatibleEmbed(p.client, url, p.apiKey, nil, model, texts)
+}
+
+// OllamaProvider talks to a local Ollama server, which exposes the same
+// chat-completions shape under /v1.
+type OllamaProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	return &OllamaProvider{client: &http.Client{}, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (p *OllamaProvider) Complete(prompt string, opts CompletionOptions) (string, error) {
+	url := fmt.Sprintf("%s/v1/chat/completions", p.baseURL)
+	return openAICompatibleComplete(p.client, url, "", nil, prompt, opts)
+}
+
+func (p *OllamaProvider) CompleteChat(messages []ChatMessage, opts CompletionOptions) (string, error) {
+	url := fmt.Sprintf("%s/v1/chat/completions", p.baseURL)
+	return openAICompatibleCompleteChat(p.client, url, "", nil, messages, opts)
+}
+
+// SupportsJSONMode is false: Ollama's OpenAI-compatible endpoint doesn't
+// honor response_format's json_schema mode today.
+func (p *OllamaProvider) SupportsJSONMode(model string) bool {
+	return false
+}
+
+func (p *OllamaProvider) Embed(texts []string, model string) ([][]float64, error) {
+	url := fmt.Sprintf("%s/v1/embeddings", p.baseURL)
+	return openAICompatibleEmbed(p.client, url, "", nil, model, texts)
+}
+
+// AzureOpenAIProvider talks to an Azure OpenAI deployment, which uses an
+// `api-key` header instead of a Bearer token and addresses the deployment
+// via the base URL rather than the model name.
+type AzureOpenAIProvider struct {
+	client     *http.Client
+	baseURL    string
+	apiKey     string
+	apiVersion string
+}
+
+func NewAzureOpenAIProvider(baseURL, apiKey, apiVersion string) *AzureOpenAIProvider {
+	if apiVersion == "" {
+		apiVersion = "2024-02-15-preview"
+	}
+	return &AzureOpenAIProvider{client: &http.Client{}, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, apiVersion: apiVersion}
+}
+
+func (p *AzureOpenAIProvider) Complete(prompt string, opts CompletionOptions) (string, error) {
+	url := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s", p.baseURL, opts.Model, p.apiVersion)
+	headers := map[string]string{"api-key": p.apiKey}
+	return openAICompatibleComplete(p.client, url, "", headers, prompt, opts)
+}
+
+func (p *AzureOpenAIProvider) CompleteChat(messages []ChatMessage, opts CompletionOptions) (string, error) {
+	url := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s", p.baseURL, opts.Model, p.apiVersion)
+	headers := map[string]string{"api-key": p.apiKey}
+	return openAICompatibleCompleteChat(p.client, url, "", headers, messages, opts)
+}
+
+func (p *AzureOpenAIProvider) SupportsJSONMode(model string) bool {
+	return modelSupportsJSONMode(model)
+}
+
+func (p *AzureOpenAIProvider) Embed(texts []string, model string) ([][]float64, error) {
+	url := fmt.Sprintf("%s/openai/deployments/%s/embeddings?api-version=%s", p.baseURL, model, p.apiVersion)
+	headers := map[string]string{"api-key": p.apiKey}
+	return openAICompatibleEmbed(p.client, url, "", headers, model, texts)
+}
+
+// snippetLabelPairsResponse is the root object produced by the structured
+// output request. OpenAI's json_schema mode requires an object at the root,
+// so the array of pairs is wrapped rather than returned bare.
+type snippetLabelPairsResponse struct {
+	Pairs []SnippetLabelPair `json:"pairs"`
+}
+
+func snippetLabelPairsSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pairs": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"label":   map[string]interface{}{"type": "string"},
+						"snippet": map[string]interface{}{"type": "string"},
+					},
+					"required":             []string{"label", "snippet"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"pairs"},
+		"additionalProperties": false,
+	}
+}
+
+// generateSnippetLabelPairsStructured asks the provider for json_schema-mode
+// output and unmarshals it directly, skipping the regex scrape entirely. The
+// bool return reports whether the structured request produced a usable
+// result; callers should fall back to regex parsing when it's false.
+func generateSnippetLabelPairsStructured(prompt string, provider Provider, opts CompletionOptions, limiter *RateLimiter, maxRetries int) ([]SnippetLabelPair, bool) {
+	opts.ResponseSchema = snippetLabelPairsSchema()
+	opts.SchemaName = "snippet_label_pairs"
+
+	content, err := completeRateLimited(provider, prompt, opts, limiter, maxRetries)
+	if err != nil {
+		log.Warnf("Structured output request failed: %s", err)
+		return nil, false
+	}
+	if content == "" {
+		return nil, false
+	}
+
+	var parsed snippetLabelPairsResponse
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		log.Warnf("Failed to parse structured output: %s", err)
+		return nil, false
+	}
+
+	return parsed.Pairs, true
+}
+
+// NewProvider builds the Provider selected by --provider, validating that
+// the flags it needs (e.g. --base-url for self-hosted backends) were given.
+func NewProvider(name, baseURL, apiKey string) (Provider, error) {
+	switch strings.ToLower(name) {
+	case "", "openai":
+		if apiKey == "" {
+			return nil, fmt.Errorf("provider %q requires an API key", name)
+		}
+		return NewOpenAIProvider(apiKey), nil
+	case "localai":
+		if baseURL == "" {
+			return nil, fmt.Errorf("provider %q requires --base-url", name)
+		}
+		return NewLocalAIProvider(baseURL, apiKey), nil
+	case "ollama":
+		if baseURL == "" {
+			baseURL = "http://localhost:11434"
+		}
+		return NewOllamaProvider(baseURL), nil
+	case "azure":
+		if baseURL == "" {
+			return nil, fmt.Errorf("provider %q requires --base-url", name)
+		}
+		if apiKey == "" {
+			return nil, fmt.Errorf("provider %q requires an API key", name)
+		}
+		return NewAzureOpenAIProvider(baseURL, apiKey, ""), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (expected one of: openai, localai, ollama, azure)", name)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestNewProviderValidation(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider string
+		baseURL  string
+		apiKey   string
+		wantErr  bool
+	}{
+		{"openai missing key", "openai", "", "", true},
+		{"openai with key", "openai", "", "sk-test", false},
+		{"default provider is openai", "", "", "sk-test", false},
+		{"localai missing base url", "localai", "", "", true},
+		{"localai with base url", "localai", "http://localhost:8080", "", false},
+		{"ollama defaults base url", "ollama", "", "", false},
+		{"azure missing base url", "azure", "", "sk-test", true},
+		{"azure missing key", "azure", "https://example.openai.azure.com", "", true},
+		{"azure with base url and key", "azure", "https://example.openai.azure.com", "sk-test", false},
+		{"unknown provider", "bogus", "", "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewProvider(c.provider, c.baseURL, c.apiKey)
+			if (err != nil) != c.wantErr {
+				t.Errorf("NewProvider(%q, %q, %q) error = %v, wantErr %v", c.provider, c.baseURL, c.apiKey, err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewProviderOllamaDefaultsBaseURL(t *testing.T) {
+	provider, err := NewProvider("ollama", "", "")
+	if err != nil {
+		t.Fatalf("NewProvider: %s", err)
+	}
+	ollama, ok := provider.(*OllamaProvider)
+	if !ok {
+		t.Fatalf("expected *OllamaProvider, got %T", provider)
+	}
+	if ollama.baseURL != "http://localhost:11434" {
+		t.Errorf("expected default base URL http://localhost:11434, got %q", ollama.baseURL)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// extractionSystemPrompt is injected ahead of the caller's messages on
+// /v1/chat/completions so that endpoint performs the same snippet
+// extraction as /v1/extract, just through a chat-completions-shaped API.
+const extractionSystemPrompt = "You are scander, an assistant that reads text and extracts concise label/snippet pairs describing its main themes."
+
+// apiError and apiErrorResponse match OpenAI's {"error": {...}} error shape.
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+func writeAPIError(w http.ResponseWriter, status int, errType, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErrorResponse{Error: apiError{Message: message, Type: errType, Code: code}})
+}
+
+// serverMetrics tracks the counters exposed at /metrics in Prometheus text
+// exposition format.
+type serverMetrics struct {
+	requestsTotal int64
+	tokensTotal   int64
+
+	latencyMu      sync.Mutex
+	latencySeconds []float64
+}
+
+func (m *serverMetrics) recordRequest(tokens int, latency time.Duration) {
+	atomic.AddInt64(&m.requestsTotal, 1)
+	atomic.AddInt64(&m.tokensTotal, int64(tokens))
+
+	m.latencyMu.Lock()
+	m.latencySeconds = append(m.latencySeconds, latency.Seconds())
+	m.latencyMu.Unlock()
+}
+
+func (m *serverMetrics) writePrometheus(w http.ResponseWriter) {
+	m.latencyMu.Lock()
+	var sum float64
+	count := len(m.latencySeconds)
+	for _, s := range m.latencySeconds {
+		sum += s
+	}
+	m.latencyMu.Unlock()
+
+	fmt.Fprintln(w, "# HELP scander_requests_total Total number of requests served.")
+	fmt.Fprintln(w, "# TYPE scander_requests_total counter")
+	fmt.Fprintf(w, "scander_requests_total %d\n", atomic.LoadInt64(&m.requestsTotal))
+
+	fmt.Fprintln(w, "# HELP scander_tokens_total Total number of tokens processed.")
+	fmt.Fprintln(w, "# TYPE scander_tokens_total counter")
+	fmt.Fprintf(w, "scander_tokens_total %d\n", atomic.LoadInt64(&m.tokensTotal))
+
+	fmt.Fprintln(w, "# HELP scander_request_latency_seconds_sum Sum of request latencies in seconds.")
+	fmt.Fprintln(w, "# TYPE scander_request_latency_seconds_sum counter")
+	fmt.Fprintf(w, "scander_request_latency_seconds_sum %f\n", sum)
+
+	fmt.Fprintln(w, "# HELP scander_request_latency_seconds_count Count of observed request latencies.")
+	fmt.Fprintln(w, "# TYPE scander_request_latency_seconds_count counter")
+	fmt.Fprintf(w, "scander_request_latency_seconds_count %d\n", count)
+}
+
+// server wraps the extraction pipeline in an OpenAI-compatible HTTP surface.
+type server struct {
+	provider Provider
+	apiKeys  map[string]bool
+	metrics  *serverMetrics
+}
+
+func newServer(provider Provider, apiKeys []string) *server {
+	keys := make(map[string]bool, len(apiKeys))
+	for _, k := range apiKeys {
+		if k = strings.TrimSpace(k); k != "" {
+			keys[k] = true
+		}
+	}
+	return &server{provider: provider, apiKeys: keys, metrics: &serverMetrics{}}
+}
+
+func (s *server) withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireAPIKey enforces `Authorization: Bearer <key>` against the keys the
+// server was started with. An empty key set disables auth entirely, which
+// is convenient for local development.
+func (s *server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.apiKeys) == 0 {
+			next(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !s.apiKeys[token] {
+			writeAPIError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+			return
+		}
+		next(w, r)
+	}
+}
+
+type extractRequest struct {
+	Text      string `json:"text"`
+	Model     string `json:"model"`
+	MaxTokens int    `json:"max_tokens"`
+}
+
+func (s *server) handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method_not_allowed", "Only POST is supported.")
+		return
+	}
+	start := time.Now()
+
+	var req extractRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_json", "Request body must be valid JSON.")
+		return
+	}
+	if req.Text == "" {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "missing_text", "The 'text' field is required.")
+		return
+	}
+
+	opts := defaultCompletionOptions()
+	if req.Model != "" {
+		opts.Model = req.Model
+	}
+	if req.MaxTokens > 0 {
+		opts.MaxTokens = req.MaxTokens
+	}
+
+	pairs, err := generateSnippetLabelPairsWithOptions(req.Text, s.provider, opts, nil, 0)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, "api_error", "provider_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pairs); err != nil {
+		log.Errorf("Failed to encode /v1/extract response: %s", err)
+	}
+
+	s.metrics.recordRequest(estimateTokens(req.Text), time.Since(start))
+}
+
+type chatCompletionsRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+}
+
+// handleChatCompletions is a passthrough that injects extractionSystemPrompt
+// ahead of the caller's messages, so clients built against the standard
+// chat-completions API get snippet extraction without a bespoke client.
+func (s *server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method_not_allowed", "Only POST is supported.")
+		return
+	}
+	start := time.Now()
+
+	var req chatCompletionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "invalid_json", "Request body must be valid JSON.")
+		return
+	}
+
+	messages := append([]ChatMessage{{Role: "system", Content: extractionSystemPrompt}}, req.Messages...)
+
+	opts := defaultCompletionOptions()
+	if req.Model != "" {
+		opts.Model = req.Model
+	}
+
+	content, err := s.provider.CompleteChat(messages, opts)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, "api_error", "provider_error", err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"id":      "chatcmpl-scander",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   opts.Model,
+		"choices": []map[string]interface{}{
+			{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": content},
+				"finish_reason": "stop",
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Errorf("Failed to encode /v1/chat/completions response: %s", err)
+	}
+
+	promptTokens := 0
+	for _, m := range messages {
+		promptTokens += estimateTokens(m.Content)
+	}
+	s.metrics.recordRequest(promptTokens+estimateTokens(content), time.Since(start))
+}
+
+func (s *server) handleModels(w http.ResponseWriter, r *http.Request) {
+	models := []map[string]interface{}{
+		{"id": "gpt-3.5-turbo", "object": "model"},
+		{"id": "gpt-4", "object": "model"},
+		{"id": "gpt-4o", "object": "model"},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": models})
+}
+
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.metrics.writePrometheus(w)
+}
+
+// runServe implements the `scander serve` subcommand: wraps the extraction
+// pipeline in an OpenAI-compatible HTTP server.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	providerName := fs.String("provider", envOrDefault("SCANDER_PROVIDER", "openai"), "LLM backend to use: openai, localai, ollama, azure")
+	baseURL := fs.String("base-url", os.Getenv("SCANDER_BASE_URL"), "Base URL for self-hosted OpenAI-compatible backends (LocalAI, Ollama, Azure)")
+	apiKeysFlag := fs.String("api-keys", os.Getenv("SCANDER_API_KEYS"), "Comma-separated list of accepted API keys (empty disables auth)")
+	fs.Parse(args)
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	provider, err := NewProvider(*providerName, *baseURL, apiKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize provider: %s", err)
+	}
+
+	var apiKeys []string
+	if *apiKeysFlag != "" {
+		apiKeys = strings.Split(*apiKeysFlag, ",")
+	}
+	srv := newServer(provider, apiKeys)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/extract", srv.withCORS(srv.requireAPIKey(srv.handleExtract)))
+	mux.HandleFunc("/v1/chat/completions", srv.withCORS(srv.requireAPIKey(srv.handleChatCompletions)))
+	mux.HandleFunc("/v1/models", srv.withCORS(srv.requireAPIKey(srv.handleModels)))
+	mux.HandleFunc("/metrics", srv.handleMetrics)
+
+	log.Infof("Listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Server error: %s", err)
+	}
+}
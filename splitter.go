@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// init points tiktoken-go at an offline BPE loader that embeds the
+// cl100k_base/o200k_base rank files instead of the library's default, which
+// fetches them over HTTP from openaipublic.blob.core.windows.net on first
+// use. Without this, newTokenSplitter requires network egress the first
+// time each encoding is loaded, which defeats running scander in an
+// air-gapped environment.
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// sentenceBoundary matches the end of a sentence or paragraph so chunks can
+// be cut there instead of mid-thought. The boundary characters stay
+// attached to the preceding segment so chunks rejoin without losing
+// spacing.
+var sentenceBoundary = regexp.MustCompile(`[.!?]\s+|\n\n+`)
+
+// modelEncodingPrefixes maps an OpenAI model name prefix to the tiktoken
+// encoding it tokenizes with.
+var modelEncodingPrefixes = []struct {
+	prefix   string
+	encoding string
+}{
+	{"gpt-4o", "o200k_base"},
+	{"o1", "o200k_base"},
+	{"o3", "o200k_base"},
+	{"gpt-4", "cl100k_base"},
+	{"gpt-3.5-turbo", "cl100k_base"},
+}
+
+// modelContextWindows maps an OpenAI model name prefix to its context
+// window size in tokens.
+var modelContextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"o1", 128000},
+	{"o3", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo-16k", 16385},
+	{"gpt-3.5-turbo", 16385},
+}
+
+func encodingForModel(model string) string {
+	for _, m := range modelEncodingPrefixes {
+		if strings.HasPrefix(model, m.prefix) {
+			return m.encoding
+		}
+	}
+	return "cl100k_base"
+}
+
+func contextWindowForModel(model string) int {
+	for _, m := range modelContextWindows {
+		if strings.HasPrefix(model, m.prefix) {
+			return m.tokens
+		}
+	}
+	return 4096
+}
+
+// bpeEncoder is the subset of tiktoken.Tiktoken's API tokenSplitter needs.
+// Depending on this instead of *tiktoken.Tiktoken directly lets tests swap
+// in a fake encoder instead of loading real BPE tables.
+type bpeEncoder interface {
+	Encode(text string, allowedSpecial, disallowedSpecial []string) []int
+}
+
+// tokenSplitter chunks text against a model's real token budget instead of
+// a character-count proxy.
+type tokenSplitter struct {
+	enc bpeEncoder
+}
+
+func newTokenSplitter(model string) (*tokenSplitter, error) {
+	enc, err := tiktoken.GetEncoding(encodingForModel(model))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer for %s: %w", model, err)
+	}
+	return &tokenSplitter{enc: enc}, nil
+}
+
+// newTokenSplitterWithEncoder builds a tokenSplitter around a caller-supplied
+// encoder, bypassing tiktoken entirely. Tests use this to verify chunking
+// logic without depending on real BPE tables.
+func newTokenSplitterWithEncoder(enc bpeEncoder) *tokenSplitter {
+	return &tokenSplitter{enc: enc}
+}
+
+func (s *tokenSplitter) countTokens(text string) int {
+	return len(s.enc.Encode(text, nil, nil))
+}
+
+// splitText chunks text to fit within contextWindow tokens minus
+// reservedCompletionTokens, preferring to break at sentence/paragraph
+// boundaries, and carries overlapTokens of trailing context into the next
+// chunk so a theme spanning a boundary isn't lost.
+func (s *tokenSplitter) splitText(text string, contextWindow, reservedCompletionTokens, overlapTokens int) []string {
+	budget := contextWindow - reservedCompletionTokens
+	if budget <= 0 {
+		budget = contextWindow
+	}
+
+	var segments []string
+	for _, seg := range splitIntoSegments(text) {
+		if s.countTokens(seg) > budget {
+			segments = append(segments, s.splitOversizedSegment(seg, budget)...)
+		} else {
+			segments = append(segments, seg)
+		}
+	}
+
+	var chunks []string
+	var current []string
+	currentTokens := 0
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		chunks = append(chunks, strings.TrimSpace(strings.Join(current, "")))
+	}
+
+	for _, seg := range segments {
+		segTokens := s.countTokens(seg)
+
+		if currentTokens+segTokens > budget && len(current) > 0 {
+			flush()
+			current = s.overlapSuffix(current, overlapTokens)
+			currentTokens = s.countTokens(strings.Join(current, ""))
+			if currentTokens+segTokens > budget {
+				current = nil
+				currentTokens = 0
+			}
+		}
+
+		current = append(current, seg)
+		currentTokens += segTokens
+	}
+	flush()
+
+	return chunks
+}
+
+// splitOversizedSegment subdivides a single sentence/paragraph segment that
+// alone exceeds budget tokens (e.g. a long punctuation-sparse paragraph, log
+// line, or code block with no sentence/blank-line boundary to break at),
+// falling back to whitespace-bounded word groups sized to fit the budget.
+func (s *tokenSplitter) splitOversizedSegment(seg string, budget int) []string {
+	words := strings.Fields(seg)
+	if len(words) == 0 {
+		return []string{seg}
+	}
+
+	var out []string
+	var current []string
+	currentTokens := 0
+
+	for _, word := range words {
+		wordTokens := s.countTokens(word)
+		if currentTokens+wordTokens > budget && len(current) > 0 {
+			out = append(out, strings.Join(current, " ")+" ")
+			current = nil
+			currentTokens = 0
+		}
+		current = append(current, word)
+		currentTokens += wordTokens
+	}
+	if len(current) > 0 {
+		out = append(out, strings.Join(current, " ")+" ")
+	}
+
+	return out
+}
+
+// splitIntoSegments breaks text at sentence/paragraph boundaries.
+func splitIntoSegments(text string) []string {
+	var segments []string
+	last := 0
+	for _, loc := range sentenceBoundary.FindAllStringIndex(text, -1) {
+		segments = append(segments, text[last:loc[1]])
+		last = loc[1]
+	}
+	if last < len(text) {
+		segments = append(segments, text[last:])
+	}
+	return segments
+}
+
+// overlapSuffix returns the trailing segments of current whose combined
+// token count is closest to, without exceeding, overlapTokens.
+func (s *tokenSplitter) overlapSuffix(current []string, overlapTokens int) []string {
+	if overlapTokens <= 0 {
+		return nil
+	}
+
+	var suffix []string
+	tokens := 0
+	for i := len(current) - 1; i >= 0; i-- {
+		t := s.countTokens(current[i])
+		if tokens+t > overlapTokens {
+			break
+		}
+		suffix = append([]string{current[i]}, suffix...)
+		tokens += t
+	}
+	return suffix
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeEncoder counts tokens as whitespace-separated words, so splitter
+// tests exercise chunking logic without loading real BPE tables.
+type fakeEncoder struct{}
+
+func (fakeEncoder) Encode(text string, allowedSpecial, disallowedSpecial []string) []int {
+	return make([]int, len(strings.Fields(text)))
+}
+
+func newTestSplitter() *tokenSplitter {
+	return newTokenSplitterWithEncoder(fakeEncoder{})
+}
+
+func TestSplitTextRespectsBudget(t *testing.T) {
+	splitter := newTestSplitter()
+
+	text := strings.Repeat("word ", 200)
+	budget := 20
+
+	chunks := splitter.splitText(text, budget, 0, 0)
+	if len(chunks) == 0 {
+		t.Fatal("expected at least one chunk")
+	}
+	for i, chunk := range chunks {
+		if tokens := splitter.countTokens(chunk); tokens > budget {
+			t.Errorf("chunk %d has %d tokens, exceeds budget %d: %q", i, tokens, budget, chunk)
+		}
+	}
+}
+
+func TestSplitOversizedSegmentSubdividesLongSegment(t *testing.T) {
+	splitter := newTestSplitter()
+
+	seg := strings.Repeat("lorem ", 100)
+	budget := 10
+
+	parts := splitter.splitOversizedSegment(seg, budget)
+	if len(parts) < 2 {
+		t.Fatalf("expected segment to be subdivided into multiple parts, got %d", len(parts))
+	}
+	for i, part := range parts {
+		if tokens := splitter.countTokens(part); tokens > budget {
+			t.Errorf("part %d has %d tokens, exceeds budget %d", i, tokens, budget)
+		}
+	}
+}
+
+func TestSplitOversizedSegmentEmptyInput(t *testing.T) {
+	splitter := newTestSplitter()
+
+	parts := splitter.splitOversizedSegment("   ", 10)
+	if len(parts) != 1 || parts[0] != "   " {
+		t.Errorf("expected whitespace-only segment to be returned as-is, got %v", parts)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+// scriptedProvider returns its completions queue in order and reports
+// SupportsJSONMode as configured, so tests can drive
+// generateSnippetLabelPairsWithOptions's structured/regex branches without
+// a real backend.
+type scriptedProvider struct {
+	jsonMode    bool
+	completions []string
+	calls       int
+}
+
+func (p *scriptedProvider) Complete(prompt string, opts CompletionOptions) (string, error) {
+	if p.calls >= len(p.completions) {
+		return "", nil
+	}
+	resp := p.completions[p.calls]
+	p.calls++
+	return resp, nil
+}
+func (p *scriptedProvider) CompleteChat(messages []ChatMessage, opts CompletionOptions) (string, error) {
+	return "", nil
+}
+func (p *scriptedProvider) SupportsJSONMode(model string) bool { return p.jsonMode }
+func (p *scriptedProvider) Embed(texts []string, model string) ([][]float64, error) {
+	return nil, nil
+}
+
+func TestGenerateSnippetLabelPairsStructuredSucceedsWithoutFallback(t *testing.T) {
+	provider := &scriptedProvider{
+		jsonMode:    true,
+		completions: []string{`{"pairs":[{"label":"a","snippet":"b"}]}`},
+	}
+
+	pairs, err := generateSnippetLabelPairsWithOptions("text", provider, defaultCompletionOptions(), nil, 0)
+	if err != nil {
+		t.Fatalf("generateSnippetLabelPairsWithOptions: %s", err)
+	}
+	if len(pairs) != 1 || pairs[0].Label != "a" {
+		t.Fatalf("expected one pair from the structured response, got %v", pairs)
+	}
+	if provider.calls != 1 {
+		t.Errorf("expected a single completion call, got %d", provider.calls)
+	}
+}
+
+func TestGenerateSnippetLabelPairsFallsBackAfterStructuredRetriesExhausted(t *testing.T) {
+	provider := &scriptedProvider{
+		jsonMode: true,
+		completions: []string{
+			"not valid json",
+			"still not valid json",
+			`{"label": "a", "snippet": "b"}`,
+		},
+	}
+
+	pairs, err := generateSnippetLabelPairsWithOptions("text", provider, defaultCompletionOptions(), nil, 0)
+	if err != nil {
+		t.Fatalf("generateSnippetLabelPairsWithOptions: %s", err)
+	}
+	if provider.calls != structuredOutputAttempts+1 {
+		t.Fatalf("expected %d structured attempts plus one regex-path call, got %d calls", structuredOutputAttempts+1, provider.calls)
+	}
+	if len(pairs) != 1 || pairs[0].Label != "a" {
+		t.Fatalf("expected the regex fallback to parse the final response, got %v", pairs)
+	}
+}
+
+func TestGenerateSnippetLabelPairsSkipsStructuredWhenUnsupported(t *testing.T) {
+	provider := &scriptedProvider{
+		jsonMode:    false,
+		completions: []string{`{"label": "a", "snippet": "b"}`},
+	}
+
+	pairs, err := generateSnippetLabelPairsWithOptions("text", provider, defaultCompletionOptions(), nil, 0)
+	if err != nil {
+		t.Fatalf("generateSnippetLabelPairsWithOptions: %s", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("expected exactly one regex-path call, got %d", provider.calls)
+	}
+	if len(pairs) != 1 || pairs[0].Label != "a" {
+		t.Fatalf("expected the regex path to parse the response, got %v", pairs)
+	}
+}